@@ -5,6 +5,8 @@ import (
     "fmt"
     "io"
     "net/http"
+    "sync"
+    "time"
 
     "github.com/gorilla/websocket"
 )
@@ -23,8 +25,29 @@ type WriteFlusher interface {
 type WriterFactory interface {
     // Creates a new writer with flushing capabilities.
     NewWriter() WriteFlusher
+
+    // Creates a new writer with flushing capabilities for binary messages.
+    NewBinaryWriter() WriteFlusher
+
+    // Creates a new writer with flushing capabilities, skipping permessage-deflate compression
+    // even if compression is enabled on the connection. Useful for already-compressed payloads.
+    NewUncompressedWriter() WriteFlusher
+
+    // Creates a new writer with flushing capabilities for binary messages, skipping
+    // permessage-deflate compression even if compression is enabled on the connection.
+    NewUncompressedBinaryWriter() WriteFlusher
 }
 
+// The type of a web socket message, mirroring the gorilla/websocket frame types.
+type MessageType int
+
+const (
+    // A text message, encoded as UTF-8.
+    TextMessage MessageType = MessageType(websocket.TextMessage)
+    // A binary message, carrying arbitrary bytes.
+    BinaryMessage MessageType = MessageType(websocket.BinaryMessage)
+)
+
 // An interface for connections with reading and writing capabilities.
 type Connection interface {
     // Include base writer factory methods in this interface.
@@ -36,10 +59,37 @@ type Connection interface {
     // - An error, if one occurs.
     NextReader() (io.Reader, error)
 
+    // Gets the next available message, along with its frame type.
+    // Returns:
+    // - The message type of the retrieved message, if available.
+    // - A reader, if available.
+    // - An error, if one occurs.
+    NextMessage() (MessageType, io.Reader, error)
+
+    // Prepares a message for efficient reuse across many writes (e.g. broadcasting the
+    // same payload to many subscribers), framing and compressing it at most once.
+    // Returns:
+    // - The prepared message, if successful.
+    // - An error, if one occurs.
+    PrepareMessage(frame_type MessageType, data []byte) (*PreparedMessage, error)
+
+    // Writes an already-prepared message directly to the connection, bypassing the
+    // per-message buffering and copying used by ordinary writers.
+    // Returns any error that occurred queuing the write.
+    WritePrepared(prepared_message *PreparedMessage) error
+
     // Closes the connection, returning any error.
     Close() error
 }
 
+// A message pre-framed once for reuse across many writes, avoiding the cost of
+// re-encoding (and re-compressing) the same payload for every subscriber it is sent to.
+type PreparedMessage struct {
+    // The underlying gorilla/websocket prepared message, which lazily frames (and
+    // compresses) itself once per distinct connection compression mode.
+    GorillaMessage *websocket.PreparedMessage
+}
+
 // A web socket connection supporting channel-based communication.
 type connection struct {
     // The web socket connection.
@@ -47,9 +97,32 @@ type connection struct {
     // for concurrency considerations.
     WebSocket *websocket.Conn
     // Channel for messages being sent across the connection.
-    MessageQueue chan io.Reader
+    MessageQueue chan queuedMessage
+    // Channel for prepared messages being sent across the connection.
+    PreparedQueue chan *PreparedMessage
     // Channel for signaling connection closure.
     Closing chan struct{}
+    // Ensures the closing channel is only ever closed once.
+    ClosingOnce sync.Once
+}
+
+// Signals that the connection is closing, safely handling repeated calls.
+func (connection *connection) signalClosing() {
+    // CLOSE THE CHANNEL FOR SIGNALING CONNECTION CLOSURE, AT MOST ONCE.
+    connection.ClosingOnce.Do(func() {
+        close(connection.Closing)
+    })
+}
+
+// A message queued for sending across a connection, along with its frame type.
+type queuedMessage struct {
+    // The reader to copy the message data from.
+    Reader io.Reader
+    // The frame type to send the message as.
+    FrameType MessageType
+    // Whether to skip permessage-deflate compression for this message,
+    // even if compression is enabled on the connection.
+    DisableCompression bool
 }
 
 // Options for configuring a connection.
@@ -60,6 +133,17 @@ type ConnectionOptions struct {
     Header http.Header
     // Underlying dialer for establishing connections.
     Dialer *websocket.Dialer
+    // Whether permessage-deflate compression is enabled for the connection.
+    EnableCompression bool
+    // The flate compression level to use when compression is enabled.
+    CompressionLevel int
+    // The interval at which ping frames are sent to the peer. Disabled when zero.
+    PingInterval time.Duration
+    // How long to wait for a pong before considering the connection dead. Disabled when zero.
+    PongTimeout time.Duration
+    // How long to wait for a write (data or ping) to complete before considering the connection dead.
+    // Disabled when zero.
+    WriteTimeout time.Duration
 }
 
 // A function type to allow setting individual connection options via functions.
@@ -91,6 +175,45 @@ func WithCookieJar(cookie_jar http.CookieJar) ConnectionOption {
     }
 }
 
+// Sets the permessage-deflate compression connection option.
+// Parameters:
+// - enable - Whether compression should be negotiated and used for the connection.
+// - level - The flate compression level to use, e.g. `flate.BestSpeed` through `flate.BestCompression`.
+func WithCompression(enable bool, level int) ConnectionOption {
+    // SET THE COMPRESSION OPTIONS WHEN CALLED ON CONNECTION OPTIONS.
+    return func(connection_options *ConnectionOptions) {
+        connection_options.EnableCompression = enable
+        connection_options.CompressionLevel = level
+        connection_options.Dialer.EnableCompression = enable
+    }
+}
+
+// Sets the ping interval connection option, enabling periodic keepalive pings.
+func WithPingInterval(ping_interval time.Duration) ConnectionOption {
+    // SET THE PING INTERVAL WHEN CALLED ON CONNECTION OPTIONS.
+    return func(connection_options *ConnectionOptions) {
+        connection_options.PingInterval = ping_interval
+    }
+}
+
+// Sets the pong timeout connection option, controlling how long to wait for a pong
+// from the peer before treating the connection as dead.
+func WithPongTimeout(pong_timeout time.Duration) ConnectionOption {
+    // SET THE PONG TIMEOUT WHEN CALLED ON CONNECTION OPTIONS.
+    return func(connection_options *ConnectionOptions) {
+        connection_options.PongTimeout = pong_timeout
+    }
+}
+
+// Sets the write timeout connection option, controlling how long to wait for a
+// data or ping write to complete before treating the connection as dead.
+func WithWriteTimeout(write_timeout time.Duration) ConnectionOption {
+    // SET THE WRITE TIMEOUT WHEN CALLED ON CONNECTION OPTIONS.
+    return func(connection_options *ConnectionOptions) {
+        connection_options.WriteTimeout = write_timeout
+    }
+}
+
 // Creates a new connection to a URL with the specified options.
 // 
 // Parameters:
@@ -116,18 +239,47 @@ func NewConnection(url string, connection_options_to_set ...ConnectionOption) (C
     }
 
     // ATTEMPT TO CONNECT TO THE URL.
-    web_socket, unused_http_response_, connection_error := connection_options.Dialer.Dial(url, options.Header)
-    connection_succeeded := (connection_error != nil)
+    web_socket, unused_http_response_, connection_error := connection_options.Dialer.Dial(url, connection_options.Header)
+    connection_succeeded := (connection_error == nil)
     if !connection_succeeded {
         // INDICATE THAT THE CONNECTION FAILED.
         return nil, connection_error
     }
 
+    // APPLY THE CONFIGURED COMPRESSION LEVEL IF COMPRESSION IS ENABLED.
+    if connection_options.EnableCompression {
+        web_socket.SetCompressionLevel(connection_options.CompressionLevel)
+    }
+
     // CREATE A CHANNEL FOR CLOSING THE CONNECTION.
     closing := make(chan struct{})
 
     // CREATE A CHANNEL IN WHICH MESSAGES CAN BE QUEUED.
-    message_channel := make(chan io.Reader, options.QueueSize)
+    message_channel := make(chan queuedMessage, connection_options.QueueSize)
+
+    // CREATE A CHANNEL FOR COORDINATING PING FRAMES WITH THE SEND GOROUTINE,
+    // SINCE GORILLA/WEBSOCKET REQUIRES SERIALIZED WRITES.
+    ping_channel := make(chan struct{})
+
+    // CREATE A CHANNEL IN WHICH PREPARED MESSAGES CAN BE QUEUED.
+    prepared_channel := make(chan *PreparedMessage, connection_options.QueueSize)
+
+    // BUILD THE CONNECTION UP FRONT SO ITS GOROUTINES CAN SIGNAL CLOSURE ON FAILURE.
+    new_connection := &connection{
+        WebSocket: web_socket,
+        MessageQueue: message_channel,
+        PreparedQueue: prepared_channel,
+        Closing: closing,
+    }
+
+    // INSTALL A READ DEADLINE AND PONG HANDLER IF PONG TIMEOUTS ARE CONFIGURED.
+    if connection_options.PongTimeout > 0 {
+        web_socket.SetReadDeadline(time.Now().Add(connection_options.PongTimeout))
+        web_socket.SetPongHandler(func(pong_payload string) error {
+            // EXTEND THE READ DEADLINE EVERY TIME A PONG IS RECEIVED.
+            return web_socket.SetReadDeadline(time.Now().Add(connection_options.PongTimeout))
+        })
+    }
 
     // DEFINE A GOROUTINE FOR PROCESSING MESSAGES OVER THE WEB SOCKET.
     go func() {
@@ -138,34 +290,90 @@ func NewConnection(url string, connection_options_to_set ...ConnectionOption) (C
             // STOP PROCESSING MESSAGES IF THE CONNECTION IS CLOSING.
             case <-closing:
                 return
+            // SEND A PING FRAME WHEN THE TICKER GOROUTINE REQUESTS ONE.
+            case <-ping_channel:
+                // APPLY THE CONFIGURED WRITE TIMEOUT, IF ANY, BEFORE WRITING.
+                if connection_options.WriteTimeout > 0 {
+                    web_socket.SetWriteDeadline(time.Now().Add(connection_options.WriteTimeout))
+                }
+
+                // TRY SENDING THE PING FRAME, CLOSING THE CONNECTION IF IT FAILS.
+                ping_write_error := web_socket.WriteMessage(websocket.PingMessage, nil)
+                ping_succeeded := (ping_write_error == nil)
+                if !ping_succeeded {
+                    new_connection.signalClosing()
+                    return
+                }
+            // WRITE ANY PREPARED MESSAGES DIRECTLY, BYPASSING THE MESSAGE BUFFER AND IO.COPY.
+            case received_prepared_message := <-prepared_channel:
+                // APPLY THE CONFIGURED WRITE TIMEOUT, IF ANY, BEFORE WRITING.
+                if connection_options.WriteTimeout > 0 {
+                    web_socket.SetWriteDeadline(time.Now().Add(connection_options.WriteTimeout))
+                }
+
+                prepared_write_error := web_socket.WritePreparedMessage(received_prepared_message.GorillaMessage)
+                prepared_write_succeeded := (prepared_write_error == nil)
+                if !prepared_write_succeeded {
+                    continue
+                }
             // PROCESS ANY MESSAGES FROM THE MAIN COMMUNICATION CHANNEL.
             case received_message := <-message_channel:
-                // TRY GETTING A WRITER FOR SENDING THE MESSAGE ON THE WEB SOCKET.
-                web_socket_writer, next_writer_error := web_socket.NextWriter(websocket.TextMessage)
-                web_socket_writer_retrieved := (next_writer_error != nil)
+                // HONOR ANY PER-MESSAGE OVERRIDE OF THE CONNECTION'S COMPRESSION SETTING.
+                if connection_options.EnableCompression {
+                    web_socket.EnableWriteCompression(!received_message.DisableCompression)
+                }
+
+                // APPLY THE CONFIGURED WRITE TIMEOUT, IF ANY, BEFORE WRITING.
+                if connection_options.WriteTimeout > 0 {
+                    web_socket.SetWriteDeadline(time.Now().Add(connection_options.WriteTimeout))
+                }
+
+                // TRY GETTING A WRITER FOR SENDING THE MESSAGE ON THE WEB SOCKET, USING ITS OWN FRAME TYPE.
+                web_socket_writer, next_writer_error := web_socket.NextWriter(int(received_message.FrameType))
+                web_socket_writer_retrieved := (next_writer_error == nil)
                 if !web_socket_writer_retrieved {
                     continue
                 }
 
                 // TRY SENDING THE MESSAGE ACROSS THE WEB SOCKET.
-                copied_byte_count_, io_copy_error := io.Copy(web_socket_writer, received_message)
-                message_copied := (io_copy_error != nil)
+                copied_byte_count_, io_copy_error := io.Copy(web_socket_writer, received_message.Reader)
+                message_copied := (io_copy_error == nil)
                 if !message_copied {
                     continue
                 }
-                
+
                 // ENSURE THE WRITER IS CLOSED.
                 web_socket_writer.Close()
             }
         }
     }()
 
+    // IF A PING INTERVAL IS CONFIGURED, SPAWN A TICKER GOROUTINE TO REQUEST PINGS.
+    if connection_options.PingInterval > 0 {
+        go func() {
+            // TICK AT THE CONFIGURED PING INTERVAL UNTIL THE CONNECTION IS CLOSED.
+            ping_ticker := time.NewTicker(connection_options.PingInterval)
+            defer ping_ticker.Stop()
+
+            for {
+                select {
+                // STOP TICKING IF THE CONNECTION IS CLOSING.
+                case <-closing:
+                    return
+                // REQUEST A PING FRAME FROM THE SEND GOROUTINE ON EVERY TICK.
+                case <-ping_ticker.C:
+                    select {
+                    case <-closing:
+                        return
+                    case ping_channel <- struct{}{}:
+                    }
+                }
+            }
+        }()
+    }
+
     // RETURN THE SUCCESSFUL CONNECTION WITHOUT AN ERROR.
-    return &connection{
-        WebSocket: web_socket,
-        MessageQueue: message_channel,
-        Closing: closing,
-    }, nil
+    return new_connection, nil
 }
 
 // Attempts to read the next text message from the connection.
@@ -174,41 +382,134 @@ func NewConnection(url string, connection_options_to_set ...ConnectionOption) (C
 // - An IO reader for retrieving the text message, if one could be retrieved.
 // - An error, if one occurred (including for unsupported message types).
 func (connection *connection) NextReader() (io.Reader, error) {
-    // TRY GETTING THE NEXT READER FROM THE WEB SOCKET.
-    message_type, io_reader, next_reader_error := connection.WebSocket.NextReader()
-    next_reader_retrieved := (next_reader_error != nil)
-    if !next_reader_retrieved {
+    // TRY GETTING THE NEXT MESSAGE FROM THE WEB SOCKET.
+    message_type, io_reader, next_message_error := connection.NextMessage()
+    next_message_retrieved := (next_message_error == nil)
+    if !next_message_retrieved {
         // INDICATE THAT NO TEXT MESSAGE COULD BE RETRIEVED.
-        return nil, next_reader_error
+        return nil, next_message_error
     }
 
     // ENSURE THE MESSAGE TYPE IS TEXT.
-    is_text_message := (message_type == websocket.TextMessage)
+    is_text_message := (message_type == TextMessage)
     if !is_text_message {
         // INDICATE THAT ONLY TEXT MESSAGES ARE SUPPORTED.
         return nil, fmt.Errorf("currently supports only text messages: %v", message_type)
     }
 
-    // READ THE TEXT MESSAGE INTO A BUFFER.
-    text_message_buffer := bytes.Buffer{}
-    text_message_buffer.ReadFrom(io_reader)
-    return &text_message_buffer, nil
+    // RETURN THE ALREADY-BUFFERED TEXT MESSAGE READER.
+    return io_reader, nil
+}
+
+// Attempts to read the next message from the connection, text or binary.
+//
+// Returns:
+// - The message type of the retrieved message, if one could be retrieved.
+// - An IO reader for retrieving the message, if one could be retrieved.
+// - An error, if one occurred.
+func (connection *connection) NextMessage() (MessageType, io.Reader, error) {
+    // TRY GETTING THE NEXT READER FROM THE WEB SOCKET.
+    message_type, io_reader, next_reader_error := connection.WebSocket.NextReader()
+    next_reader_retrieved := (next_reader_error == nil)
+    if !next_reader_retrieved {
+        // INDICATE THAT NO MESSAGE COULD BE RETRIEVED.
+        return 0, nil, next_reader_error
+    }
+
+    // READ THE MESSAGE INTO A BUFFER.
+    message_buffer := bytes.Buffer{}
+    message_buffer.ReadFrom(io_reader)
+    return MessageType(message_type), &message_buffer, nil
 }
 
 // Creates a new writer with flushing capabilities for the connection.
 func (connection *connection) NewWriter() WriteFlusher {
     // CREATE AN AYSNC WRITER FOR THE CONNECTION.
     return &asyncWriter{
-        MessageQueue: connection.MessageQueue, 
-        Closing: connection.Closing, 
-        MessageBuffer: &bytes.Buffer{}
+        MessageQueue: connection.MessageQueue,
+        Closing: connection.Closing,
+        MessageBuffer: &bytes.Buffer{},
+        FrameType: TextMessage,
+    }
+}
+
+// Creates a new writer with flushing capabilities for the connection, sending binary messages.
+func (connection *connection) NewBinaryWriter() WriteFlusher {
+    // CREATE AN ASYNC WRITER FOR THE CONNECTION, FRAMED AS A BINARY MESSAGE.
+    return &asyncWriter{
+        MessageQueue: connection.MessageQueue,
+        Closing: connection.Closing,
+        MessageBuffer: &bytes.Buffer{},
+        FrameType: BinaryMessage,
+    }
+}
+
+// Creates a new writer with flushing capabilities for the connection, skipping compression.
+func (connection *connection) NewUncompressedWriter() WriteFlusher {
+    // CREATE AN ASYNC WRITER FOR THE CONNECTION WITH COMPRESSION DISABLED.
+    return &asyncWriter{
+        MessageQueue: connection.MessageQueue,
+        Closing: connection.Closing,
+        MessageBuffer: &bytes.Buffer{},
+        FrameType: TextMessage,
+        DisableCompression: true,
+    }
+}
+
+// Creates a new writer with flushing capabilities for the connection, sending binary
+// messages and skipping compression.
+func (connection *connection) NewUncompressedBinaryWriter() WriteFlusher {
+    // CREATE AN ASYNC WRITER FOR THE CONNECTION, FRAMED AS A BINARY MESSAGE WITH COMPRESSION DISABLED.
+    return &asyncWriter{
+        MessageQueue: connection.MessageQueue,
+        Closing: connection.Closing,
+        MessageBuffer: &bytes.Buffer{},
+        FrameType: BinaryMessage,
+        DisableCompression: true,
     }
 }
 
+// Prepares a message for efficient reuse across many writes, framing (and, once
+// compression is enabled, compressing) the payload at most once.
+func (connection *connection) PrepareMessage(frame_type MessageType, data []byte) (*PreparedMessage, error) {
+    // BUILD THE UNDERLYING GORILLA PREPARED MESSAGE.
+    gorilla_message, prepare_error := websocket.NewPreparedMessage(int(frame_type), data)
+    prepared_successfully := (prepare_error == nil)
+    if !prepared_successfully {
+        // INDICATE THAT THE MESSAGE COULD NOT BE PREPARED.
+        return nil, prepare_error
+    }
+
+    return &PreparedMessage{GorillaMessage: gorilla_message}, nil
+}
+
+// Writes an already-prepared message to the connection, bypassing the message buffer.
+// If the connection is already closing, the write may be discarded.
+// Always returns `nil` since no errors can occur.
+func (connection *connection) WritePrepared(prepared_message *PreparedMessage) error {
+    // RETURN EARLY IF THE CONNECTION IS CLOSING.
+    select {
+    case <-connection.Closing:
+        // INDICATE THAT NO WRITE ERRORS OCCURRED.
+        return nil
+    default:
+    }
+
+    // CHECK THE CONNECTION'S CHANNELS.
+    select {
+    case <-connection.Closing:
+    // QUEUE THE PREPARED MESSAGE FOR THE SEND GOROUTINE.
+    case connection.PreparedQueue <- prepared_message:
+    }
+
+    // INDICATE THAT NO WRITE ERRORS OCCURRED.
+    return nil
+}
+
 // Completely closes a connection, returning any errors.
 func (connection *connection) Close() error {
-    // CLOSE THE CHANNEL FOR SIGNALING CONNECTION CLOSURE.
-    close(connection.Closing)
+    // SIGNAL THAT THE CONNECTION IS CLOSING.
+    connection.signalClosing()
 
     // CLOSE THE WEB SOCKET, RETURNING ANY ERROR.
     web_socket_close_error := connection.WebSocket.Close()
@@ -218,11 +519,15 @@ func (connection *connection) Close() error {
 // A asynchronous writer for sending messages over channels.
 type asyncWriter struct {
     // The channel serving as a queue for messages.
-    MessageQueue chan<- io.Reader
+    MessageQueue chan<- queuedMessage
     // Channel for detecting connection closure.
     Closing <-chan struct{}
     // Buffer to hold raw message data.
     MessageBuffer *bytes.Buffer
+    // The frame type to queue flushed messages as.
+    FrameType MessageType
+    // Whether to skip permessage-deflate compression for messages from this writer.
+    DisableCompression bool
 }
 
 // Write bytes to the writer's buffer.
@@ -252,8 +557,12 @@ func (writer *asyncWriter) Flush() error {
     // CHECK THE WRITER'S CHANNELS.
     select {
     case <-writer.Closing:
-    // SEND ANY BUFFERED MESSAGES INTO THE QUEUE.
-    case writer.MessageQueue <- writer.MessageBuffer:
+    // SEND ANY BUFFERED MESSAGES INTO THE QUEUE, ALONG WITH THEIR FRAME TYPE AND COMPRESSION OVERRIDE.
+    case writer.MessageQueue <- (queuedMessage{
+        Reader: writer.MessageBuffer,
+        FrameType: writer.FrameType,
+        DisableCompression: writer.DisableCompression,
+    }):
     }
 
     // INDICATE THAT NO FLUSHING ERRORS OCCURRED.
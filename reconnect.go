@@ -0,0 +1,436 @@
+package gomasio
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "math/rand"
+    "sync"
+    "time"
+)
+
+// A hook invoked with the freshly dialed connection after every successful reconnect,
+// e.g. to resend Socket.IO handshake/subscribe frames.
+type ReconnectHook func(Connection) error
+
+// Options for configuring a ReconnectingConnection.
+type ReconnectingConnectionOptions struct {
+    // The underlying dial options to use on every (re)connect attempt.
+    DialOptions []ConnectionOption
+    // The backoff delay after the first failed reconnect attempt, doubled after each further failure.
+    // The first attempt is made immediately.
+    MinDelay time.Duration
+    // The maximum backoff delay between reconnect attempts, once backoff has grown.
+    // Random jitter of up to the current backoff delay is added on top of it.
+    MaxDelay time.Duration
+    // The maximum number of consecutive reconnect attempts before giving up. Zero means unlimited.
+    MaxAttempts int
+    // A hook invoked with the new connection after every successful reconnect.
+    OnReconnect ReconnectHook
+}
+
+// A function type to allow setting individual reconnecting connection options via functions.
+type ReconnectingConnectionOption func(reconnecting_options *ReconnectingConnectionOptions)
+
+// Sets the dial options connection option, used on every (re)connect attempt.
+func WithDialOptions(connection_options_to_set ...ConnectionOption) ReconnectingConnectionOption {
+    // SET THE DIAL OPTIONS WHEN CALLED ON RECONNECTING CONNECTION OPTIONS.
+    return func(reconnecting_options *ReconnectingConnectionOptions) {
+        reconnecting_options.DialOptions = connection_options_to_set
+    }
+}
+
+// Sets the reconnect connection option, controlling exponential backoff bounds and
+// the maximum number of consecutive attempts (zero for unlimited) before giving up.
+func WithReconnect(min_delay time.Duration, max_delay time.Duration, max_attempts int) ReconnectingConnectionOption {
+    // SET THE RECONNECT BACKOFF OPTIONS WHEN CALLED ON RECONNECTING CONNECTION OPTIONS.
+    return func(reconnecting_options *ReconnectingConnectionOptions) {
+        reconnecting_options.MinDelay = min_delay
+        reconnecting_options.MaxDelay = max_delay
+        reconnecting_options.MaxAttempts = max_attempts
+    }
+}
+
+// Sets the on-reconnect hook connection option, invoked with the new connection
+// after every successful reconnect.
+func OnReconnect(on_reconnect ReconnectHook) ReconnectingConnectionOption {
+    // SET THE ON-RECONNECT HOOK WHEN CALLED ON RECONNECTING CONNECTION OPTIONS.
+    return func(reconnecting_options *ReconnectingConnectionOptions) {
+        reconnecting_options.OnReconnect = on_reconnect
+    }
+}
+
+// A reader that also reports which reconnect epoch it was read during, so a consumer
+// piping messages across reconnects can detect that a mid-stream reconnect occurred.
+type EpochReader struct {
+    // The underlying reader for the message.
+    io.Reader
+    // The reconnect epoch the message was read during.
+    Epoch uint64
+}
+
+// A connection wrapper that transparently redials on read or write failure (or
+// peer-initiated close) with exponential backoff and jitter, using the same dial
+// options every time. Buffered but unflushed writes are preserved across reconnects.
+type ReconnectingConnection struct {
+    // The URL to redial on every (re)connect attempt.
+    URL string
+    // The options to use for backoff, dial options, and the reconnect hook.
+    Options ReconnectingConnectionOptions
+
+    // Channel for messages being sent across the connection, owned by the wrapper
+    // (rather than the underlying connection) so it survives reconnects.
+    MessageQueue chan queuedMessage
+    // Channel for signaling that the wrapper itself is closing for good.
+    Closing chan struct{}
+    // Ensures the closing channel is only ever closed once.
+    ClosingOnce sync.Once
+
+    // Serializes redials, so callers observing the same failed connection redial only once.
+    ReconnectMutex sync.Mutex
+    // Guards Current and Epoch, which change on every reconnect.
+    Mutex sync.Mutex
+    // The currently active underlying connection.
+    Current Connection
+    // A monotonically increasing count of how many times this wrapper has reconnected.
+    Epoch uint64
+}
+
+// Creates a new reconnecting connection to a URL with the specified options, dialing
+// the initial underlying connection before returning.
+//
+// Parameters:
+// - url - The URL to connect (and reconnect) with.
+// - reconnecting_options_to_set - The options to set for the reconnecting connection.
+//
+// Returns:
+// - The reconnecting connection, if the initial dial succeeded.
+// - An error, if one occurred.
+func NewReconnectingConnection(url string, reconnecting_options_to_set ...ReconnectingConnectionOption) (*ReconnectingConnection, error) {
+    // CREATE DEFAULT RECONNECTING CONNECTION OPTIONS.
+    reconnecting_options := &ReconnectingConnectionOptions{
+        MinDelay: time.Second,
+        MaxDelay: 30 * time.Second,
+        MaxAttempts: 0,
+    }
+
+    // APPLY ANY ADDITIONAL RECONNECTING CONNECTION OPTIONS.
+    for unused_index_, additional_reconnecting_option := range reconnecting_options_to_set {
+        additional_reconnecting_option(reconnecting_options)
+    }
+
+    // DIAL THE INITIAL UNDERLYING CONNECTION.
+    initial_connection, dial_error := NewConnection(url, reconnecting_options.DialOptions...)
+    dial_succeeded := (dial_error == nil)
+    if !dial_succeeded {
+        // INDICATE THAT THE INITIAL CONNECTION FAILED.
+        return nil, dial_error
+    }
+
+    reconnecting_connection := &ReconnectingConnection{
+        URL: url,
+        Options: *reconnecting_options,
+        MessageQueue: make(chan queuedMessage, 100),
+        Closing: make(chan struct{}),
+        Current: initial_connection,
+    }
+
+    // DEFINE A GOROUTINE FOR FORWARDING QUEUED MESSAGES TO WHICHEVER CONNECTION IS CURRENT.
+    go reconnecting_connection.forwardMessages()
+
+    return reconnecting_connection, nil
+}
+
+// Signals that the wrapper is closing for good, safely handling repeated calls.
+func (reconnecting_connection *ReconnectingConnection) signalClosing() {
+    // CLOSE THE CHANNEL FOR SIGNALING WRAPPER CLOSURE, AT MOST ONCE.
+    reconnecting_connection.ClosingOnce.Do(func() {
+        close(reconnecting_connection.Closing)
+    })
+}
+
+// Gets the currently active underlying connection.
+func (reconnecting_connection *ReconnectingConnection) connectionSnapshot() Connection {
+    // READ THE CURRENT CONNECTION UNDER THE MUTEX.
+    reconnecting_connection.Mutex.Lock()
+    defer reconnecting_connection.Mutex.Unlock()
+    return reconnecting_connection.Current
+}
+
+// Continuously forwards queued messages to the currently active underlying connection,
+// retrying against whichever connection becomes current if a send fails.
+func (reconnecting_connection *ReconnectingConnection) forwardMessages() {
+    // CONTINUOUSLY FORWARD MESSAGES UNTIL THE WRAPPER IS CLOSED.
+    for {
+        select {
+        // STOP FORWARDING MESSAGES IF THE WRAPPER IS CLOSING.
+        case <-reconnecting_connection.Closing:
+            return
+        // FORWARD EACH QUEUED MESSAGE, RETRYING ACROSS RECONNECTS UNTIL IT IS SENT.
+        case queued_message := <-reconnecting_connection.MessageQueue:
+            reconnecting_connection.sendWithRetry(queued_message)
+        }
+    }
+}
+
+// Sends a single queued message, redialing and retrying against the new connection
+// if the current one fails, until it is sent or the wrapper is closed.
+func (reconnecting_connection *ReconnectingConnection) sendWithRetry(queued_message queuedMessage) {
+    // BUFFER THE MESSAGE BODY ONCE SO IT CAN BE REPLAYED ACROSS MULTIPLE ATTEMPTS.
+    message_body_buffer := bytes.Buffer{}
+    message_body_buffer.ReadFrom(queued_message.Reader)
+    message_body := message_body_buffer.Bytes()
+
+    for {
+        select {
+        case <-reconnecting_connection.Closing:
+            return
+        default:
+        }
+
+        current_connection := reconnecting_connection.connectionSnapshot()
+        writer := writerForMessage(current_connection, queued_message)
+
+        write_byte_count_, write_error := writer.Write(message_body)
+        write_succeeded := (write_error == nil)
+        if !write_succeeded {
+            reconnecting_connection.reconnect(current_connection)
+            continue
+        }
+
+        flush_error := writer.Flush()
+        flush_succeeded := (flush_error == nil)
+        if !flush_succeeded {
+            reconnecting_connection.reconnect(current_connection)
+            continue
+        }
+
+        return
+    }
+}
+
+// Picks the writer factory method matching a queued message's frame type and
+// compression override on the given connection.
+func writerForMessage(target_connection Connection, queued_message queuedMessage) WriteFlusher {
+    // SELECT THE WRITER FACTORY METHOD MATCHING THE MESSAGE'S FRAME TYPE AND COMPRESSION OVERRIDE.
+    is_binary_message := (queued_message.FrameType == BinaryMessage)
+    switch {
+    case is_binary_message && queued_message.DisableCompression:
+        return target_connection.NewUncompressedBinaryWriter()
+    case is_binary_message:
+        return target_connection.NewBinaryWriter()
+    case queued_message.DisableCompression:
+        return target_connection.NewUncompressedWriter()
+    default:
+        return target_connection.NewWriter()
+    }
+}
+
+// Redials the connection with exponential backoff and jitter, replacing Current and
+// bumping Epoch on success. Only the first caller observing a given failed connection
+// performs the redial; later callers find Current already replaced and return immediately.
+func (reconnecting_connection *ReconnectingConnection) reconnect(failed_connection Connection) {
+    // SERIALIZE REDIALS SO A CALLER ARRIVING MID-REDIAL WAITS, THEN FINDS CURRENT ALREADY REPLACED.
+    reconnecting_connection.ReconnectMutex.Lock()
+    defer reconnecting_connection.ReconnectMutex.Unlock()
+
+    reconnecting_connection.Mutex.Lock()
+    already_reconnected := (reconnecting_connection.Current != failed_connection)
+    reconnecting_connection.Mutex.Unlock()
+    if already_reconnected {
+        // ANOTHER CALLER ALREADY REDIALED FOR THIS FAILURE; NOTHING MORE TO DO.
+        return
+    }
+
+    // CLOSE THE FAILED CONNECTION SO ITS RESOURCES ARE RELEASED.
+    failed_connection.Close()
+
+    delay := reconnecting_connection.Options.MinDelay
+    attempt := 0
+
+    for {
+        select {
+        case <-reconnecting_connection.Closing:
+            return
+        default:
+        }
+
+        exceeded_max_attempts := (reconnecting_connection.Options.MaxAttempts > 0 && attempt >= reconnecting_connection.Options.MaxAttempts)
+        if exceeded_max_attempts {
+            // GIVE UP AND TEAR DOWN THE WRAPPER FOR GOOD.
+            reconnecting_connection.signalClosing()
+            return
+        }
+        attempt++
+
+        new_connection, dial_error := NewConnection(reconnecting_connection.URL, reconnecting_connection.Options.DialOptions...)
+        dial_succeeded := (dial_error == nil)
+        if !dial_succeeded {
+            // WAIT OUT THE BACKOFF DELAY (WITH JITTER) BEFORE THE NEXT ATTEMPT.
+            jitter := time.Duration(rand.Int63n(int64(delay) + 1))
+            time.Sleep(delay + jitter)
+
+            delay = nextBackoffDelay(delay, reconnecting_connection.Options.MaxDelay)
+            continue
+        }
+
+        // RUN THE RECONNECT HOOK, IF ANY, BEFORE PUBLISHING THE NEW CONNECTION.
+        if reconnecting_connection.Options.OnReconnect != nil {
+            reconnecting_connection.Options.OnReconnect(new_connection)
+        }
+
+        reconnecting_connection.Mutex.Lock()
+        reconnecting_connection.Current = new_connection
+        reconnecting_connection.Epoch++
+        reconnecting_connection.Mutex.Unlock()
+        return
+    }
+}
+
+// Doubles the previous backoff delay, clamping to the maximum delay.
+//
+// Parameters:
+// - previous_delay - The delay used for the attempt that just failed.
+// - max_delay - The maximum delay to clamp the doubled delay to.
+//
+// Returns:
+// - The delay to use for the next reconnect attempt.
+func nextBackoffDelay(previous_delay time.Duration, max_delay time.Duration) time.Duration {
+    // DOUBLE THE PREVIOUS DELAY, CLAMPING TO THE MAXIMUM DELAY.
+    doubled_delay := previous_delay * 2
+    delay_exceeds_max := (doubled_delay > max_delay)
+    if delay_exceeds_max {
+        return max_delay
+    }
+    return doubled_delay
+}
+
+// Creates a new writer with flushing capabilities for the reconnecting connection.
+func (reconnecting_connection *ReconnectingConnection) NewWriter() WriteFlusher {
+    // CREATE AN ASYNC WRITER QUEUING ONTO THE WRAPPER'S OWN MESSAGE QUEUE.
+    return &asyncWriter{
+        MessageQueue: reconnecting_connection.MessageQueue,
+        Closing: reconnecting_connection.Closing,
+        MessageBuffer: &bytes.Buffer{},
+        FrameType: TextMessage,
+    }
+}
+
+// Creates a new writer with flushing capabilities for the reconnecting connection, sending binary messages.
+func (reconnecting_connection *ReconnectingConnection) NewBinaryWriter() WriteFlusher {
+    // CREATE AN ASYNC WRITER QUEUING ONTO THE WRAPPER'S OWN MESSAGE QUEUE, FRAMED AS A BINARY MESSAGE.
+    return &asyncWriter{
+        MessageQueue: reconnecting_connection.MessageQueue,
+        Closing: reconnecting_connection.Closing,
+        MessageBuffer: &bytes.Buffer{},
+        FrameType: BinaryMessage,
+    }
+}
+
+// Creates a new writer with flushing capabilities for the reconnecting connection, skipping compression.
+func (reconnecting_connection *ReconnectingConnection) NewUncompressedWriter() WriteFlusher {
+    // CREATE AN ASYNC WRITER QUEUING ONTO THE WRAPPER'S OWN MESSAGE QUEUE WITH COMPRESSION DISABLED.
+    return &asyncWriter{
+        MessageQueue: reconnecting_connection.MessageQueue,
+        Closing: reconnecting_connection.Closing,
+        MessageBuffer: &bytes.Buffer{},
+        FrameType: TextMessage,
+        DisableCompression: true,
+    }
+}
+
+// Creates a new writer with flushing capabilities for the reconnecting connection, sending binary
+// messages and skipping compression.
+func (reconnecting_connection *ReconnectingConnection) NewUncompressedBinaryWriter() WriteFlusher {
+    // CREATE AN ASYNC WRITER QUEUING ONTO THE WRAPPER'S OWN MESSAGE QUEUE, FRAMED AS BINARY WITH COMPRESSION DISABLED.
+    return &asyncWriter{
+        MessageQueue: reconnecting_connection.MessageQueue,
+        Closing: reconnecting_connection.Closing,
+        MessageBuffer: &bytes.Buffer{},
+        FrameType: BinaryMessage,
+        DisableCompression: true,
+    }
+}
+
+// Attempts to read the next text message from the connection, redialing on failure.
+//
+// Returns:
+// - An IO reader for retrieving the text message, if one could be retrieved. The reader
+//   also implements `*EpochReader` semantics, reporting the epoch it was read during.
+// - An error, if one occurred (including for unsupported message types).
+func (reconnecting_connection *ReconnectingConnection) NextReader() (io.Reader, error) {
+    // TRY GETTING THE NEXT MESSAGE FROM THE CURRENT CONNECTION.
+    message_type, epoch_reader, next_message_error := reconnecting_connection.NextMessage()
+    next_message_retrieved := (next_message_error == nil)
+    if !next_message_retrieved {
+        return nil, next_message_error
+    }
+
+    // ENSURE THE MESSAGE TYPE IS TEXT, WITHOUT TREATING OTHER TYPES AS A CONNECTION FAILURE.
+    is_text_message := (message_type == TextMessage)
+    if !is_text_message {
+        return nil, fmt.Errorf("currently supports only text messages: %v", message_type)
+    }
+    return epoch_reader, nil
+}
+
+// Attempts to read the next message from the connection, text or binary, redialing on failure.
+//
+// Returns:
+// - The message type of the retrieved message, if one could be retrieved.
+// - An IO reader for retrieving the message (also reporting its reconnect epoch), if available.
+// - An error, if one occurred.
+func (reconnecting_connection *ReconnectingConnection) NextMessage() (MessageType, io.Reader, error) {
+    // TRY GETTING THE NEXT MESSAGE FROM THE CURRENT CONNECTION.
+    return reconnecting_connection.nextMessageWithEpoch(func(current_connection Connection) (MessageType, io.Reader, error) {
+        return current_connection.NextMessage()
+    })
+}
+
+// Reads from the current connection using the given reader function, redialing and
+// retrying on failure, and wraps the result with the epoch it was read during.
+func (reconnecting_connection *ReconnectingConnection) nextMessageWithEpoch(read_from func(Connection) (MessageType, io.Reader, error)) (MessageType, io.Reader, error) {
+    for {
+        select {
+        case <-reconnecting_connection.Closing:
+            return 0, nil, io.EOF
+        default:
+        }
+
+        reconnecting_connection.Mutex.Lock()
+        current_connection := reconnecting_connection.Current
+        current_epoch := reconnecting_connection.Epoch
+        reconnecting_connection.Mutex.Unlock()
+
+        message_type, message_reader, read_error := read_from(current_connection)
+        read_succeeded := (read_error == nil)
+        if !read_succeeded {
+            reconnecting_connection.reconnect(current_connection)
+            continue
+        }
+
+        return message_type, &EpochReader{Reader: message_reader, Epoch: current_epoch}, nil
+    }
+}
+
+// Prepares a message for efficient reuse across many writes on the current connection.
+func (reconnecting_connection *ReconnectingConnection) PrepareMessage(frame_type MessageType, data []byte) (*PreparedMessage, error) {
+    // DELEGATE PREPARATION TO THE CURRENTLY ACTIVE CONNECTION.
+    return reconnecting_connection.connectionSnapshot().PrepareMessage(frame_type, data)
+}
+
+// Writes an already-prepared message to the connection, bypassing the message buffer.
+func (reconnecting_connection *ReconnectingConnection) WritePrepared(prepared_message *PreparedMessage) error {
+    // DELEGATE THE PREPARED WRITE TO THE CURRENTLY ACTIVE CONNECTION.
+    return reconnecting_connection.connectionSnapshot().WritePrepared(prepared_message)
+}
+
+// Completely closes the reconnecting connection, tearing it down for good (it will not reconnect).
+func (reconnecting_connection *ReconnectingConnection) Close() error {
+    // SIGNAL THAT THE WRAPPER IS CLOSING FOR GOOD.
+    reconnecting_connection.signalClosing()
+
+    // CLOSE THE CURRENTLY ACTIVE UNDERLYING CONNECTION, RETURNING ANY ERROR.
+    current_connection_close_error := reconnecting_connection.connectionSnapshot().Close()
+    return current_connection_close_error
+}
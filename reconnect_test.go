@@ -0,0 +1,41 @@
+package gomasio
+
+import (
+    "testing"
+    "time"
+)
+
+// Verifies that the backoff delay doubles on each successive failed attempt.
+func TestNextBackoffDelayDoubles(t *testing.T) {
+    max_delay := 30 * time.Second
+
+    first_delay := nextBackoffDelay(time.Second, max_delay)
+    first_delay_correct := (first_delay == 2*time.Second)
+    if !first_delay_correct {
+        t.Fatalf("expected first backoff delay of 2s, got %s", first_delay)
+    }
+
+    second_delay := nextBackoffDelay(first_delay, max_delay)
+    second_delay_correct := (second_delay == 4*time.Second)
+    if !second_delay_correct {
+        t.Fatalf("expected second backoff delay of 4s, got %s", second_delay)
+    }
+}
+
+// Verifies that the backoff delay is clamped to the maximum delay once it would
+// otherwise exceed it, rather than continuing to double indefinitely.
+func TestNextBackoffDelayClampsToMax(t *testing.T) {
+    max_delay := 30 * time.Second
+
+    clamped_delay := nextBackoffDelay(20*time.Second, max_delay)
+    clamped_to_max := (clamped_delay == max_delay)
+    if !clamped_to_max {
+        t.Fatalf("expected backoff delay to clamp to %s, got %s", max_delay, clamped_delay)
+    }
+
+    still_clamped_delay := nextBackoffDelay(clamped_delay, max_delay)
+    still_clamped_to_max := (still_clamped_delay == max_delay)
+    if !still_clamped_to_max {
+        t.Fatalf("expected backoff delay to stay clamped at %s, got %s", max_delay, still_clamped_delay)
+    }
+}
@@ -0,0 +1,380 @@
+package gomasio
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+)
+
+// An interface for message transports, abstracting over the underlying mechanism
+// (WebSocket or HTTP long-polling) used to exchange Engine.IO packets with a server.
+type Transport interface {
+    // Creates a new writer with flushing capabilities.
+    NewWriter() WriteFlusher
+
+    // Gets the next available reader.
+    // Returns:
+    // - A reader, if available.
+    // - An error, if one occurs.
+    NextReader() (io.Reader, error)
+
+    // Closes the transport, returning any error.
+    Close() error
+}
+
+// A transport that sends and receives Engine.IO packets over an established web socket.
+type websocketTransport struct {
+    // The underlying web socket connection.
+    *connection
+}
+
+// The handshake payload an Engine.IO server returns when a long-polling session is opened.
+// See https://github.com/socketio/engine.io-protocol for the packet format.
+type engineIOHandshake struct {
+    SID string `json:"sid"`
+    Upgrades []string `json:"upgrades"`
+    PingInterval int `json:"pingInterval"`
+    PingTimeout int `json:"pingTimeout"`
+}
+
+// A transport that sends and receives Engine.IO packets over HTTP long-polling.
+type pollingTransport struct {
+    // The HTTP client used to issue polling requests.
+    HTTPClient *http.Client
+    // The base polling URL, including the `EIO`/`transport` query parameters.
+    PollingURL string
+    // The session id assigned by the server during the handshake.
+    SID string
+    // HTTP headers to send with every polling request.
+    Header http.Header
+}
+
+// Builds the full polling URL for this transport's session, including the session id.
+func (transport *pollingTransport) sessionURL() string {
+    // APPEND THE SESSION ID TO THE BASE POLLING URL.
+    return fmt.Sprintf("%s&sid=%s", transport.PollingURL, transport.SID)
+}
+
+// Posts a single framed Engine.IO packet to the server.
+func (transport *pollingTransport) postPacket(framed_packet string) error {
+    // BUILD THE OUTGOING POLLING REQUEST.
+    post_request, new_request_error := http.NewRequest(http.MethodPost, transport.sessionURL(), strings.NewReader(framed_packet))
+    request_built := (new_request_error == nil)
+    if !request_built {
+        // INDICATE THAT THE REQUEST COULD NOT BE BUILT.
+        return new_request_error
+    }
+    if transport.Header != nil {
+        post_request.Header = transport.Header
+    }
+
+    // POST THE PACKET TO THE SERVER.
+    post_response, post_error := transport.HTTPClient.Do(post_request)
+    post_succeeded := (post_error == nil)
+    if !post_succeeded {
+        // INDICATE THAT THE POST FAILED.
+        return post_error
+    }
+    defer post_response.Body.Close()
+
+    // INDICATE THAT NO ERROR OCCURRED.
+    return nil
+}
+
+// Creates a new writer with flushing capabilities for the polling transport.
+func (transport *pollingTransport) NewWriter() WriteFlusher {
+    // CREATE A POLLING WRITER FOR THE TRANSPORT.
+    return &pollingWriter{
+        Transport: transport,
+        MessageBuffer: &bytes.Buffer{},
+    }
+}
+
+// Attempts to read the next text message from the polling transport.
+//
+// Returns:
+// - An IO reader for retrieving the text message, if one could be retrieved.
+// - An error, if one occurred.
+func (transport *pollingTransport) NextReader() (io.Reader, error) {
+    // BUILD THE INBOUND POLLING REQUEST.
+    get_request, new_request_error := http.NewRequest(http.MethodGet, transport.sessionURL(), nil)
+    request_built := (new_request_error == nil)
+    if !request_built {
+        // INDICATE THAT THE REQUEST COULD NOT BE BUILT.
+        return nil, new_request_error
+    }
+    if transport.Header != nil {
+        get_request.Header = transport.Header
+    }
+
+    // GET THE NEXT PACKET PAYLOAD FROM THE SERVER.
+    get_response, get_error := transport.HTTPClient.Do(get_request)
+    get_succeeded := (get_error == nil)
+    if !get_succeeded {
+        // INDICATE THAT THE GET FAILED.
+        return nil, get_error
+    }
+    defer get_response.Body.Close()
+
+    // A POLL RESPONSE MAY BATCH SEVERAL ENGINE.IO PACKETS, SEPARATED BY \x1e.
+    packet_buffer := bytes.Buffer{}
+    packet_buffer.ReadFrom(get_response.Body)
+    packet_payload := packet_buffer.String()
+
+    // FIND THE FIRST MESSAGE PACKET (TYPE 4); SKIP NON-DATA PACKETS LIKE PING/PONG/NOOP.
+    message_packet, extract_error := extractMessagePacket(packet_payload)
+    extracted_successfully := (extract_error == nil)
+    if !extracted_successfully {
+        // INDICATE THAT THE POLL RESPONSE CONTAINED NO MESSAGE PACKETS.
+        return nil, extract_error
+    }
+
+    return strings.NewReader(message_packet), nil
+}
+
+// Extracts the first message packet (type 4) from a batch of Engine.IO packets,
+// separated by the \x1e record separator, skipping non-data packets like ping/pong/noop.
+//
+// Parameters:
+// - packet_payload - The raw, possibly-batched polling response payload.
+//
+// Returns:
+// - The message packet's data, with its leading type digit stripped, if one was found.
+// - An error, if the payload contained no message packets.
+func extractMessagePacket(packet_payload string) (string, error) {
+    batched_packets := strings.Split(packet_payload, "\x1e")
+
+    for unused_index_, packet := range batched_packets {
+        has_packet_type := (len(packet) > 0)
+        if !has_packet_type {
+            continue
+        }
+
+        is_message_packet := (packet[0] == '4')
+        if !is_message_packet {
+            continue
+        }
+
+        return packet[1:], nil
+    }
+
+    return "", fmt.Errorf("no message packet in engine.io polling payload: %q", packet_payload)
+}
+
+// Closes the polling transport, sending an Engine.IO close packet to the server.
+func (transport *pollingTransport) Close() error {
+    // SEND THE ENGINE.IO CLOSE PACKET (TYPE 1).
+    return transport.postPacket("1")
+}
+
+// A writer that buffers a single Engine.IO message packet, posting it on flush.
+type pollingWriter struct {
+    // The polling transport to post the flushed packet to.
+    Transport *pollingTransport
+    // Buffer to hold the raw message data.
+    MessageBuffer *bytes.Buffer
+}
+
+// Write bytes to the writer's buffer.
+func (writer *pollingWriter) Write(bytes_to_write []byte) (written_byte_count int, write_error error) {
+    // WRITE BYTES TO THE BUFFER AND RETURN THE RESULTS.
+    written_byte_count, write_error = writer.MessageBuffer.Write(bytes_to_write)
+    return written_byte_count, write_error
+}
+
+// Flushes the buffered data to the server as an Engine.IO message packet (type 4).
+func (writer *pollingWriter) Flush() error {
+    // FRAME THE BUFFERED DATA AS AN ENGINE.IO MESSAGE PACKET AND POST IT.
+    return writer.Transport.postPacket("4" + writer.MessageBuffer.String())
+}
+
+// Creates a new Engine.IO connection to a URL, performing the long-polling handshake and
+// attempting to upgrade to a web socket transport, falling back to long-polling on failure.
+//
+// Parameters:
+// - base_url - The base URL of the Engine.IO server (e.g. `http://example.com`).
+// - connection_options_to_set - The options to set for the web socket transport, if upgraded to.
+//
+// Returns:
+// - The transport, if the handshake succeeded.
+// - An error, if one occurred.
+func NewEngineIOConnection(base_url string, connection_options_to_set ...ConnectionOption) (Transport, error) {
+    // PARSE THE BASE URL SO BOTH THE POLLING AND WEB SOCKET ENDPOINTS CAN BE DERIVED FROM IT.
+    parsed_url, parse_url_error := url.Parse(base_url)
+    parsed_successfully := (parse_url_error == nil)
+    if !parsed_successfully {
+        // INDICATE THAT THE BASE URL COULD NOT BE PARSED.
+        return nil, parse_url_error
+    }
+
+    // BUILD THE ENGINE.IO LONG-POLLING HANDSHAKE URL.
+    polling_url := *parsed_url
+    polling_url.Scheme = httpSchemeFor(parsed_url.Scheme)
+    polling_url.Path = strings.TrimRight(parsed_url.Path, "/") + "/engine.io/"
+    polling_url.RawQuery = "EIO=4&transport=polling"
+
+    // PERFORM THE ENGINE.IO HANDSHAKE OVER HTTP LONG-POLLING.
+    http_client := &http.Client{}
+    handshake_response, handshake_error := http_client.Get(polling_url.String())
+    handshake_succeeded := (handshake_error == nil)
+    if !handshake_succeeded {
+        // INDICATE THAT THE HANDSHAKE FAILED.
+        return nil, handshake_error
+    }
+    defer handshake_response.Body.Close()
+
+    handshake_body := bytes.Buffer{}
+    handshake_body.ReadFrom(handshake_response.Body)
+    handshake_payload := handshake_body.String()
+
+    // PARSE THE ENGINE.IO "OPEN" PACKET (TYPE 0) CARRYING THE HANDSHAKE'S JSON PAYLOAD.
+    handshake, parse_handshake_error := parseEngineIOHandshake(handshake_payload)
+    parsed_handshake_successfully := (parse_handshake_error == nil)
+    if !parsed_handshake_successfully {
+        // INDICATE THAT THE HANDSHAKE PAYLOAD COULD NOT BE PARSED.
+        return nil, parse_handshake_error
+    }
+
+    // BUILD THE POLLING TRANSPORT AS A FALLBACK, IN CASE THE WEB SOCKET UPGRADE FAILS.
+    polling := &pollingTransport{
+        HTTPClient: http_client,
+        PollingURL: polling_url.String(),
+        SID: handshake.SID,
+    }
+
+    // SEE IF THE SERVER ADVERTISES SUPPORT FOR UPGRADING TO A WEB SOCKET TRANSPORT.
+    supports_websocket_upgrade := false
+    for unused_index_, upgrade := range handshake.Upgrades {
+        if upgrade == "websocket" {
+            supports_websocket_upgrade = true
+        }
+    }
+    if !supports_websocket_upgrade {
+        // FALL BACK TO THE HTTP LONG-POLLING TRANSPORT.
+        return polling, nil
+    }
+
+    // ATTEMPT THE WEB SOCKET UPGRADE, CARRYING OVER THE SERVER'S PING SETTINGS.
+    websocket_connection, upgrade_error := upgradeToWebsocket(parsed_url, handshake, connection_options_to_set)
+    upgrade_succeeded := (upgrade_error == nil)
+    if !upgrade_succeeded {
+        // FALL BACK TO THE HTTP LONG-POLLING TRANSPORT.
+        return polling, nil
+    }
+
+    return websocket_connection, nil
+}
+
+// Attempts to upgrade an Engine.IO session to a web socket transport, probing the
+// connection before confirming the switch, per the Engine.IO upgrade handshake.
+func upgradeToWebsocket(base_url *url.URL, handshake engineIOHandshake, connection_options_to_set []ConnectionOption) (Transport, error) {
+    // BUILD THE ENGINE.IO WEB SOCKET UPGRADE URL.
+    websocket_url := *base_url
+    websocket_url.Scheme = wsSchemeFor(base_url.Scheme)
+    websocket_url.Path = strings.TrimRight(base_url.Path, "/") + "/engine.io/"
+    websocket_url.RawQuery = fmt.Sprintf("EIO=4&transport=websocket&sid=%s", handshake.SID)
+
+    // CARRY OVER THE SERVER'S PING SETTINGS UNLESS THE CALLER ALREADY CONFIGURED THEM.
+    default_options := []ConnectionOption{
+        WithPingInterval(time.Duration(handshake.PingInterval) * time.Millisecond),
+        WithPongTimeout(time.Duration(handshake.PingTimeout) * time.Millisecond),
+    }
+    all_options := append(default_options, connection_options_to_set...)
+
+    // DIAL THE WEB SOCKET UPGRADE ENDPOINT.
+    web_socket_connection, dial_error := NewConnection(websocket_url.String(), all_options...)
+    dial_succeeded := (dial_error == nil)
+    if !dial_succeeded {
+        // INDICATE THAT THE UPGRADE DIAL FAILED.
+        return nil, dial_error
+    }
+
+    // SEND THE ENGINE.IO PROBE PACKET (PING PACKET CARRYING "probe") AND AWAIT THE ECHOED PONG.
+    probe_writer := web_socket_connection.NewWriter()
+    probe_writer.Write([]byte("2probe"))
+    probe_writer.Flush()
+
+    probe_reader, probe_read_error := web_socket_connection.NextReader()
+    probe_read_succeeded := (probe_read_error == nil)
+    if !probe_read_succeeded {
+        // INDICATE THAT THE PROBE WAS NOT ACKNOWLEDGED.
+        web_socket_connection.Close()
+        return nil, probe_read_error
+    }
+
+    probe_buffer := bytes.Buffer{}
+    probe_buffer.ReadFrom(probe_reader)
+    probe_acknowledged := (probe_buffer.String() == "3probe")
+    if !probe_acknowledged {
+        // INDICATE THAT THE PROBE RESPONSE WAS UNEXPECTED.
+        web_socket_connection.Close()
+        return nil, fmt.Errorf("unexpected engine.io probe response: %q", probe_buffer.String())
+    }
+
+    // CONFIRM THE UPGRADE SO THE SERVER STOPS SERVING THE POLLING TRANSPORT.
+    upgrade_writer := web_socket_connection.NewWriter()
+    upgrade_writer.Write([]byte("5"))
+    upgrade_writer.Flush()
+
+    return &websocketTransport{connection: web_socket_connection.(*connection)}, nil
+}
+
+// Parses an Engine.IO "open" packet (type 0), whose payload is the packet type digit
+// followed by the handshake's JSON body.
+//
+// Parameters:
+// - handshake_payload - The raw packet payload received from the handshake request.
+//
+// Returns:
+// - The parsed handshake, if the payload was a well-formed open packet.
+// - An error, if one occurred.
+func parseEngineIOHandshake(handshake_payload string) (engineIOHandshake, error) {
+    // ENSURE THE HANDSHAKE RESPONSE IS AN ENGINE.IO "OPEN" PACKET (TYPE 0).
+    is_open_packet := strings.HasPrefix(handshake_payload, "0")
+    if !is_open_packet {
+        // INDICATE THAT THE HANDSHAKE PAYLOAD WAS UNEXPECTED.
+        return engineIOHandshake{}, fmt.Errorf("unexpected engine.io handshake payload: %q", handshake_payload)
+    }
+
+    // PARSE THE HANDSHAKE'S JSON PAYLOAD, WHICH FOLLOWS THE PACKET TYPE DIGIT.
+    handshake := engineIOHandshake{}
+    unmarshal_error := json.Unmarshal([]byte(handshake_payload[1:]), &handshake)
+    unmarshalled_successfully := (unmarshal_error == nil)
+    if !unmarshalled_successfully {
+        // INDICATE THAT THE HANDSHAKE PAYLOAD COULD NOT BE PARSED.
+        return engineIOHandshake{}, unmarshal_error
+    }
+
+    return handshake, nil
+}
+
+// Maps a URL scheme to its HTTP equivalent, leaving already-HTTP schemes untouched.
+func httpSchemeFor(scheme string) string {
+    // MAP WEB SOCKET SCHEMES TO THEIR HTTP EQUIVALENTS.
+    switch scheme {
+    case "wss":
+        return "https"
+    case "ws":
+        return "http"
+    default:
+        return scheme
+    }
+}
+
+// Maps a URL scheme to its web socket equivalent, leaving already-WS schemes untouched.
+func wsSchemeFor(scheme string) string {
+    // MAP HTTP SCHEMES TO THEIR WEB SOCKET EQUIVALENTS.
+    switch scheme {
+    case "https":
+        return "wss"
+    case "http":
+        return "ws"
+    default:
+        return scheme
+    }
+}
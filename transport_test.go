@@ -0,0 +1,155 @@
+package gomasio
+
+import (
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+)
+
+// Verifies that a well-formed Engine.IO open packet is parsed into its handshake fields.
+func TestParseEngineIOHandshakeParsesOpenPacket(t *testing.T) {
+    open_packet := `0{"sid":"abc123","upgrades":["websocket"],"pingInterval":25000,"pingTimeout":20000}`
+
+    handshake, parse_error := parseEngineIOHandshake(open_packet)
+    parsed_successfully := (parse_error == nil)
+    if !parsed_successfully {
+        t.Fatalf("expected handshake to parse, got error: %v", parse_error)
+    }
+
+    sid_correct := (handshake.SID == "abc123")
+    if !sid_correct {
+        t.Fatalf("expected sid %q, got %q", "abc123", handshake.SID)
+    }
+
+    ping_interval_correct := (handshake.PingInterval == 25000)
+    if !ping_interval_correct {
+        t.Fatalf("expected ping interval 25000, got %d", handshake.PingInterval)
+    }
+
+    advertises_websocket := false
+    for unused_index_, upgrade := range handshake.Upgrades {
+        if upgrade == "websocket" {
+            advertises_websocket = true
+        }
+    }
+    if !advertises_websocket {
+        t.Fatalf("expected upgrades to include websocket, got %v", handshake.Upgrades)
+    }
+}
+
+// Verifies that a payload not starting with the Engine.IO open packet type (0) is rejected.
+func TestParseEngineIOHandshakeRejectsNonOpenPacket(t *testing.T) {
+    _, parse_error := parseEngineIOHandshake(`4{"sid":"abc123"}`)
+    parse_failed := (parse_error != nil)
+    if !parse_failed {
+        t.Fatalf("expected an error for a non-open packet, got none")
+    }
+}
+
+// Verifies that a batched polling payload's first message packet (type 4) is extracted,
+// skipping leading non-data packets like ping/pong/noop.
+func TestExtractMessagePacketSkipsNonDataPackets(t *testing.T) {
+    batched_payload := strings.Join([]string{"2", "6", "4hello"}, "\x1e")
+
+    message, extract_error := extractMessagePacket(batched_payload)
+    extracted_successfully := (extract_error == nil)
+    if !extracted_successfully {
+        t.Fatalf("expected a message packet to be found, got error: %v", extract_error)
+    }
+
+    message_correct := (message == "hello")
+    if !message_correct {
+        t.Fatalf("expected message %q, got %q", "hello", message)
+    }
+}
+
+// Verifies that a batch containing no message packets (type 4) is reported as an error,
+// rather than silently returning a non-message packet's body.
+func TestExtractMessagePacketErrorsWithNoMessagePacket(t *testing.T) {
+    batched_payload := strings.Join([]string{"2", "6"}, "\x1e")
+
+    _, extract_error := extractMessagePacket(batched_payload)
+    extract_failed := (extract_error != nil)
+    if !extract_failed {
+        t.Fatalf("expected an error when no message packet is present, got none")
+    }
+}
+
+// Verifies that postPacket actually POSTs the framed packet to the server, rather
+// than reporting success while dropping it.
+func TestPollingTransportPostPacketSendsFramedPacket(t *testing.T) {
+    var received_body string
+    var received_method string
+    test_server := httptest.NewServer(http.HandlerFunc(func(response_writer http.ResponseWriter, request *http.Request) {
+        received_method = request.Method
+        body_bytes, _ := io.ReadAll(request.Body)
+        received_body = string(body_bytes)
+    }))
+    defer test_server.Close()
+
+    transport := &pollingTransport{
+        HTTPClient: test_server.Client(),
+        PollingURL: test_server.URL + "?EIO=4&transport=polling",
+        SID: "test-sid",
+    }
+
+    post_error := transport.postPacket("4hello")
+    posted_successfully := (post_error == nil)
+    if !posted_successfully {
+        t.Fatalf("expected postPacket to succeed, got error: %v", post_error)
+    }
+
+    method_correct := (received_method == http.MethodPost)
+    if !method_correct {
+        t.Fatalf("expected a POST request, got %q", received_method)
+    }
+
+    body_correct := (received_body == "4hello")
+    if !body_correct {
+        t.Fatalf("expected posted body %q, got %q", "4hello", received_body)
+    }
+}
+
+// Verifies that NextReader actually GETs and reads a batched poll response from the
+// server, returning the first message packet, rather than reporting success with a nil reader.
+func TestPollingTransportNextReaderReadsBatchedResponse(t *testing.T) {
+    var request_count int
+    var mutex sync.Mutex
+    test_server := httptest.NewServer(http.HandlerFunc(func(response_writer http.ResponseWriter, request *http.Request) {
+        mutex.Lock()
+        request_count++
+        mutex.Unlock()
+        response_writer.Write([]byte(strings.Join([]string{"2", "4hello"}, "\x1e")))
+    }))
+    defer test_server.Close()
+
+    transport := &pollingTransport{
+        HTTPClient: test_server.Client(),
+        PollingURL: test_server.URL + "?EIO=4&transport=polling",
+        SID: "test-sid",
+    }
+
+    message_reader, next_reader_error := transport.NextReader()
+    read_succeeded := (next_reader_error == nil)
+    if !read_succeeded {
+        t.Fatalf("expected NextReader to succeed, got error: %v", next_reader_error)
+    }
+
+    message_bytes, read_error := io.ReadAll(message_reader)
+    if read_error != nil {
+        t.Fatalf("expected to read the message reader, got error: %v", read_error)
+    }
+
+    message_correct := (string(message_bytes) == "hello")
+    if !message_correct {
+        t.Fatalf("expected message %q, got %q", "hello", string(message_bytes))
+    }
+
+    request_issued := (request_count == 1)
+    if !request_issued {
+        t.Fatalf("expected exactly one GET request, got %d", request_count)
+    }
+}